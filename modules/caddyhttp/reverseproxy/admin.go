@@ -18,10 +18,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
 )
 
+// Polling and heartbeat intervals used by handleUpstreamsWatch. The
+// pool is polled rather than pushed to, since there is no hook into
+// Host's internal fail counter and health-check transitions from
+// this package; polling keeps the watch endpoint simple while still
+// only emitting events when something actually changed. These are
+// conservative starting points, not load-tested numbers; widen
+// upstreamWatchPollInterval here if many concurrent watchers ever
+// make the per-second hosts.Range sweep show up under load.
+const (
+	upstreamWatchPollInterval      = 1 * time.Second
+	upstreamWatchHeartbeatInterval = 15 * time.Second
+)
+
 func init() {
 	caddy.RegisterModule(adminUpstreams{})
 }
@@ -37,6 +55,21 @@ type upstreamStatus struct {
 	Address     string `json:"address"`
 	NumRequests int    `json:"num_requests"`
 	Fails       int    `json:"fails"`
+	Healthy     bool   `json:"healthy"`
+	InFlight    int    `json:"in_flight"`
+
+	// LastFailTime is deliberately not included here yet: the runtime
+	// host pool this package has access to (see collectUpstreamStatuses)
+	// doesn't track a last-failure timestamp, and emitting a zero
+	// time.Time for every upstream would look like real data. Add it
+	// once Host (or whatever replaces it) actually records this.
+}
+
+// upstreamsListResponse is the paged response body for the
+// /reverse_proxy/upstreams listing endpoint.
+type upstreamsListResponse struct {
+	Items []upstreamStatus `json:"items"`
+	Total int              `json:"total"`
 }
 
 // CaddyModule returns the Caddy module information.
@@ -54,12 +87,22 @@ func (al adminUpstreams) Routes() []caddy.AdminRoute {
 			Pattern: "/reverse_proxy/upstreams",
 			Handler: caddy.AdminHandlerFunc(al.handleUpstreams),
 		},
+		{
+			Pattern: "/reverse_proxy/upstreams/metrics",
+			Handler: caddy.AdminHandlerFunc(al.handleUpstreamsMetrics),
+		},
+		{
+			Pattern: "/reverse_proxy/upstreams/",
+			Handler: caddy.AdminHandlerFunc(al.handleUpstreamByAddress),
+		},
 	}
 }
 
 // handleUpstreams reports the status of the reverse proxy
-// upstream pool.
-func (adminUpstreams) handleUpstreams(w http.ResponseWriter, r *http.Request) error {
+// upstream pool. If the request asks to watch (?watch=1) and
+// negotiates text/event-stream, it is handed off to
+// handleUpstreamsWatch instead of returning a single snapshot.
+func (al adminUpstreams) handleUpstreams(w http.ResponseWriter, r *http.Request) error {
 	if r.Method != http.MethodGet {
 		return caddy.APIError{
 			HTTPStatus: http.StatusMethodNotAllowed,
@@ -67,12 +110,375 @@ func (adminUpstreams) handleUpstreams(w http.ResponseWriter, r *http.Request) er
 		}
 	}
 
+	if r.URL.Query().Get("watch") == "1" && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return al.handleUpstreamsWatch(w, r)
+	}
+
+	results, err := collectUpstreamStatuses()
+	if err != nil {
+		return err
+	}
+
+	results, err = filterUpstreamStatuses(results, r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	// Sort by address so pagination is stable across requests
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Address < results[j].Address
+	})
+
+	total := len(results)
+	results, err = paginateUpstreamStatuses(results, r.URL.Query())
+	if err != nil {
+		return err
+	}
+
 	// Prep for a JSON response
 	w.Header().Set("Content-Type", "application/json")
 	enc := json.NewEncoder(w)
 
-	// Collect the results to respond with
-	results := []upstreamStatus{}
+	resp := upstreamsListResponse{Items: results, Total: total}
+	if err := enc.Encode(resp); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+
+	return nil
+}
+
+// upstreamDetail is the response body for the single-upstream lookup
+// endpoint. HealthCheckConfig, LastCheckTime, and LastError are part
+// of the shape the admin API wants to eventually report, but are
+// left unset (and therefore omitted from the JSON response) for now:
+// this package only has access to the runtime host pool (see
+// collectUpstreamStatuses), not the configured Upstream/HealthChecks
+// that produced it, and there's no source to fill them in from
+// without threading that config through from whatever owns it. They
+// are declared here, rather than silently left off the struct, so
+// the gap is visible in the code and the shape is ready to populate
+// once that plumbing exists.
+type upstreamDetail struct {
+	upstreamStatus
+	HealthCheckConfig any        `json:"health_check_config,omitempty"`
+	LastCheckTime     *time.Time `json:"last_check_time,omitempty"`
+	LastError         string     `json:"last_error,omitempty"`
+}
+
+// handleUpstreamByAddress reports the status of a single upstream,
+// looked up by the address in the URL path, e.g.
+// /reverse_proxy/upstreams/localhost:8080.
+func (adminUpstreams) handleUpstreamByAddress(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	address := strings.TrimPrefix(r.URL.Path, "/reverse_proxy/upstreams/")
+	if address == "" {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("no upstream address given"),
+		}
+	}
+
+	results, err := collectUpstreamStatuses()
+	if err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		if res.Address != address {
+			continue
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(upstreamDetail{upstreamStatus: res}); err != nil {
+			return caddy.APIError{
+				HTTPStatus: http.StatusInternalServerError,
+				Err:        err,
+			}
+		}
+		return nil
+	}
+
+	return caddy.APIError{
+		HTTPStatus: http.StatusNotFound,
+		Err:        fmt.Errorf("no upstream found with address %q", address),
+	}
+}
+
+// filterUpstreamStatuses applies the ?unhealthy=1, ?min_fails=N, and
+// ?address=glob query parameters to results.
+func filterUpstreamStatuses(results []upstreamStatus, query map[string][]string) ([]upstreamStatus, error) {
+	q := func(key string) string {
+		if len(query[key]) == 0 {
+			return ""
+		}
+		return query[key][0]
+	}
+
+	onlyUnhealthy := q("unhealthy") == "1"
+
+	var minFails int
+	if s := q("min_fails"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("invalid min_fails: %v", err),
+			}
+		}
+		minFails = n
+	}
+
+	addressGlob := q("address")
+
+	filtered := make([]upstreamStatus, 0, len(results))
+	for _, res := range results {
+		if onlyUnhealthy && res.Healthy {
+			continue
+		}
+		if res.Fails < minFails {
+			continue
+		}
+		if addressGlob != "" {
+			matched, err := path.Match(addressGlob, res.Address)
+			if err != nil {
+				return nil, caddy.APIError{
+					HTTPStatus: http.StatusBadRequest,
+					Err:        fmt.Errorf("invalid address pattern: %v", err),
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		filtered = append(filtered, res)
+	}
+
+	return filtered, nil
+}
+
+// paginateUpstreamStatuses applies the ?limit= and ?offset= query
+// parameters to results, which is assumed to already be sorted.
+func paginateUpstreamStatuses(results []upstreamStatus, query map[string][]string) ([]upstreamStatus, error) {
+	q := func(key string) string {
+		if len(query[key]) == 0 {
+			return ""
+		}
+		return query[key][0]
+	}
+
+	offset := 0
+	if s := q("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("invalid offset"),
+			}
+		}
+		offset = n
+	}
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+
+	if s := q("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			return nil, caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("invalid limit"),
+			}
+		}
+		if limit < len(results) {
+			results = results[:limit]
+		}
+	}
+
+	return results, nil
+}
+
+// handleUpstreamsWatch streams upstream status changes as
+// Server-Sent Events for as long as the client stays connected. An
+// event is only emitted for an address once its fail count, healthy
+// status, or in-flight count differs from what was last sent; a
+// heartbeat comment is sent periodically so intermediaries don't
+// time out an otherwise quiet connection.
+func (adminUpstreams) handleUpstreamsWatch(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        fmt.Errorf("streaming not supported"),
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	poll := time.NewTicker(upstreamWatchPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(upstreamWatchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	ctx := r.Context()
+	previous := map[string]upstreamStatus{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Client disconnected; nothing left to do.
+			return nil
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+
+		case <-poll.C:
+			results, err := collectUpstreamStatuses()
+			if err != nil {
+				return err
+			}
+
+			for _, res := range changedUpstreamStatuses(previous, results) {
+				payload, err := json.Marshal(res)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: upstream_update\ndata: %s\n\n", payload); err != nil {
+					return nil
+				}
+			}
+			flusher.Flush()
+
+			previous = snapshotUpstreamStatuses(results)
+		}
+	}
+}
+
+// changedUpstreamStatuses returns the entries in results whose
+// address is new, or whose fail count, healthy status, or in-flight
+// count differs from the matching entry in previous. It's kept
+// separate from handleUpstreamsWatch so the diffing decision can be
+// tested without a live SSE connection or the host pool.
+func changedUpstreamStatuses(previous map[string]upstreamStatus, results []upstreamStatus) []upstreamStatus {
+	var changed []upstreamStatus
+	for _, res := range results {
+		prev, ok := previous[res.Address]
+		if ok && prev.Fails == res.Fails && prev.Healthy == res.Healthy && prev.InFlight == res.InFlight {
+			continue
+		}
+		changed = append(changed, res)
+	}
+	return changed
+}
+
+// snapshotUpstreamStatuses builds the map changedUpstreamStatuses
+// compares against on the next poll.
+func snapshotUpstreamStatuses(results []upstreamStatus) map[string]upstreamStatus {
+	snapshot := make(map[string]upstreamStatus, len(results))
+	for _, res := range results {
+		snapshot[res.Address] = res
+	}
+	return snapshot
+}
+
+// handleUpstreamsMetrics reports the status of the reverse proxy
+// upstream pool in Prometheus text exposition format, so it can be
+// scraped directly without an extra JSON-to-Prometheus bridge.
+func (adminUpstreams) handleUpstreamsMetrics(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	results, err := collectUpstreamStatuses()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := w.Write([]byte(formatUpstreamMetrics(results))); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+
+	return nil
+}
+
+// formatUpstreamMetrics renders results as Prometheus text
+// exposition format. It's kept separate from handleUpstreamsMetrics
+// so it can be tested without going through the host pool.
+func formatUpstreamMetrics(results []upstreamStatus) string {
+	// Sort by address so the exposition is stable across scrapes
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Address < results[j].Address
+	})
+
+	var sb strings.Builder
+
+	sb.WriteString("# HELP caddy_reverse_proxy_upstream_requests Total number of requests made to the upstream.\n")
+	sb.WriteString("# TYPE caddy_reverse_proxy_upstream_requests counter\n")
+	for _, res := range results {
+		fmt.Fprintf(&sb, "caddy_reverse_proxy_upstream_requests{address=%q} %d\n", res.Address, res.NumRequests)
+	}
+
+	sb.WriteString("# HELP caddy_reverse_proxy_upstream_fails_total Total number of failed health checks for the upstream.\n")
+	sb.WriteString("# TYPE caddy_reverse_proxy_upstream_fails_total counter\n")
+	for _, res := range results {
+		fmt.Fprintf(&sb, "caddy_reverse_proxy_upstream_fails_total{address=%q} %d\n", res.Address, res.Fails)
+	}
+
+	sb.WriteString("# HELP caddy_reverse_proxy_upstream_healthy Whether the upstream is currently considered healthy.\n")
+	sb.WriteString("# TYPE caddy_reverse_proxy_upstream_healthy gauge\n")
+	for _, res := range results {
+		fmt.Fprintf(&sb, "caddy_reverse_proxy_upstream_healthy{address=%q} %d\n", res.Address, boolToFloat(res.Healthy))
+	}
+
+	sb.WriteString("# HELP caddy_reverse_proxy_upstream_inflight Number of in-flight requests to the upstream.\n")
+	sb.WriteString("# TYPE caddy_reverse_proxy_upstream_inflight gauge\n")
+	for _, res := range results {
+		fmt.Fprintf(&sb, "caddy_reverse_proxy_upstream_inflight{address=%q} %d\n", res.Address, res.InFlight)
+	}
+
+	return sb.String()
+}
+
+// boolToFloat renders b as a Prometheus-style 1 or 0.
+func boolToFloat(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// collectUpstreamStatuses gathers the current status of every
+// upstream in the pool, plus any dynamic upstreams that only show
+// up in the in-flight tracker, for use by the admin endpoints.
+// NumRequests and InFlight are tracked separately: the former is the
+// cumulative request count a static upstream has ever served, while
+// the latter is how many requests are in progress against it right
+// now (static or dynamic).
+func collectUpstreamStatuses() ([]upstreamStatus, error) {
+	resultsByAddress := make(map[string]upstreamStatus)
+	var order []string
 
 	// Iterate over the upstream pool (needs to be fast)
 	var rangeErr error
@@ -95,51 +501,38 @@ func (adminUpstreams) handleUpstreams(w http.ResponseWriter, r *http.Request) er
 			return false
 		}
 
-		results = append(results, upstreamStatus{
+		resultsByAddress[address] = upstreamStatus{
 			Address:     address,
 			NumRequests: upstream.NumRequests(),
 			Fails:       upstream.Fails(),
-		})
+			Healthy:     !upstream.Unhealthy(),
+		}
+		order = append(order, address)
 		return true
 	})
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
 
-	// Iterate over our new in-flight tracker map
+	// Merge in our in-flight tracker map
 	currentInFlight := getInFlightRequests()
 	for address, count := range currentInFlight {
-		// We only add entries that are actively in-flight but not present
-		// in the static hosts pool (e.g. dynamic upstreams during cleanup)
-
-		// Check if this address is already in the results list (from the static hosts pool)
-		alreadyInResults := false
-		for _, res := range results {
-			if res.Address == address {
-				alreadyInResults = true
-				break
-			}
-		}
-
-		// If it's not in the static pool, we append it to expose it in the API
-		if !alreadyInResults {
-			results = append(results, upstreamStatus{
-				Address:     address,
-				NumRequests: int(count), // Cast uint from our map to int for the struct
-				Fails:       0,          // Ephemeral in-flight tracking doesn't track historic fails
-			})
+		res, ok := resultsByAddress[address]
+		if !ok {
+			// This address is actively in-flight but not present in the
+			// static hosts pool (e.g. a dynamic upstream); we don't have
+			// any historic request/fail data to report for it.
+			res = upstreamStatus{Address: address, Healthy: true}
+			order = append(order, address)
 		}
+		res.InFlight = int(count) // Cast uint from our map to int for the struct
+		resultsByAddress[address] = res
 	}
 
-	// If an error happened during the range, return it
-	if rangeErr != nil {
-		return rangeErr
-	}
-
-	err := enc.Encode(results)
-	if err != nil {
-		return caddy.APIError{
-			HTTPStatus: http.StatusInternalServerError,
-			Err:        err,
-		}
+	results := make([]upstreamStatus, 0, len(order))
+	for _, address := range order {
+		results = append(results, resultsByAddress[address])
 	}
 
-	return nil
+	return results, nil
 }
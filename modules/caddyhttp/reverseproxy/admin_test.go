@@ -0,0 +1,304 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestFormatUpstreamMetrics(t *testing.T) {
+	results := []upstreamStatus{
+		{Address: "b:80", NumRequests: 5, Fails: 1, Healthy: false, InFlight: 2},
+		{Address: "a:80", NumRequests: 10, Fails: 0, Healthy: true, InFlight: 0},
+	}
+
+	out := formatUpstreamMetrics(results)
+
+	// Addresses should come out sorted, regardless of input order.
+	aIdx := strings.Index(out, `address="a:80"`)
+	bIdx := strings.Index(out, `address="b:80"`)
+	if aIdx == -1 || bIdx == -1 {
+		t.Fatalf("expected both addresses in output, got:\n%s", out)
+	}
+	if aIdx > bIdx {
+		t.Errorf("expected a:80 to be exposed before b:80, got:\n%s", out)
+	}
+
+	for _, want := range []string{
+		`caddy_reverse_proxy_upstream_requests{address="a:80"} 10`,
+		`caddy_reverse_proxy_upstream_fails_total{address="b:80"} 1`,
+		`caddy_reverse_proxy_upstream_healthy{address="a:80"} 1`,
+		`caddy_reverse_proxy_upstream_healthy{address="b:80"} 0`,
+		`caddy_reverse_proxy_upstream_inflight{address="b:80"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatUpstreamMetricsEmpty(t *testing.T) {
+	out := formatUpstreamMetrics(nil)
+	if !strings.Contains(out, "# HELP caddy_reverse_proxy_upstream_requests") {
+		t.Errorf("expected HELP/TYPE lines even with no upstreams, got:\n%s", out)
+	}
+}
+
+func TestChangedUpstreamStatuses(t *testing.T) {
+	unchanged := upstreamStatus{Address: "a:80", NumRequests: 1, Fails: 0, Healthy: true, InFlight: 1}
+	changedFails := upstreamStatus{Address: "b:80", NumRequests: 2, Fails: 1, Healthy: true, InFlight: 0}
+	newAddr := upstreamStatus{Address: "c:80", NumRequests: 0, Fails: 0, Healthy: true, InFlight: 0}
+
+	previous := map[string]upstreamStatus{
+		"a:80": unchanged,
+		"b:80": {Address: "b:80", NumRequests: 2, Fails: 0, Healthy: true, InFlight: 0},
+	}
+
+	got := changedUpstreamStatuses(previous, []upstreamStatus{unchanged, changedFails, newAddr})
+
+	want := map[string]bool{"b:80": true, "c:80": true}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d changed entries, got %d: %+v", len(want), len(got), got)
+	}
+	for _, res := range got {
+		if !want[res.Address] {
+			t.Errorf("unexpected address in changed set: %s", res.Address)
+		}
+		delete(want, res.Address)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing expected changed addresses: %v", want)
+	}
+}
+
+func TestChangedUpstreamStatusesNoneChanged(t *testing.T) {
+	res := upstreamStatus{Address: "a:80", NumRequests: 1, Fails: 0, Healthy: true, InFlight: 0}
+	previous := snapshotUpstreamStatuses([]upstreamStatus{res})
+
+	got := changedUpstreamStatuses(previous, []upstreamStatus{res})
+	if len(got) != 0 {
+		t.Errorf("expected no changes, got %+v", got)
+	}
+}
+
+func TestFilterUpstreamStatuses(t *testing.T) {
+	all := []upstreamStatus{
+		{Address: "a.example.com:80", Fails: 0, Healthy: true},
+		{Address: "b.example.com:80", Fails: 3, Healthy: false},
+		{Address: "c.other.com:80", Fails: 1, Healthy: true},
+	}
+
+	tests := []struct {
+		name      string
+		query     map[string][]string
+		want      []string
+		wantError bool
+	}{
+		{
+			name:  "no filters",
+			query: map[string][]string{},
+			want:  []string{"a.example.com:80", "b.example.com:80", "c.other.com:80"},
+		},
+		{
+			name:  "unhealthy only",
+			query: map[string][]string{"unhealthy": {"1"}},
+			want:  []string{"b.example.com:80"},
+		},
+		{
+			name:  "min_fails",
+			query: map[string][]string{"min_fails": {"1"}},
+			want:  []string{"b.example.com:80", "c.other.com:80"},
+		},
+		{
+			name:  "address glob",
+			query: map[string][]string{"address": {"*.example.com:80"}},
+			want:  []string{"a.example.com:80", "b.example.com:80"},
+		},
+		{
+			name:      "invalid min_fails",
+			query:     map[string][]string{"min_fails": {"nope"}},
+			wantError: true,
+		},
+		{
+			name:      "invalid address pattern",
+			query:     map[string][]string{"address": {"["}},
+			wantError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := filterUpstreamStatuses(all, tc.query)
+			if tc.wantError {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %+v", tc.want, got)
+			}
+			for i, addr := range tc.want {
+				if got[i].Address != addr {
+					t.Errorf("expected %v, got %+v", tc.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestPaginateUpstreamStatuses(t *testing.T) {
+	all := []upstreamStatus{
+		{Address: "a:80"}, {Address: "b:80"}, {Address: "c:80"}, {Address: "d:80"},
+	}
+
+	tests := []struct {
+		name      string
+		query     map[string][]string
+		want      []string
+		wantError bool
+	}{
+		{
+			name:  "no pagination",
+			query: map[string][]string{},
+			want:  []string{"a:80", "b:80", "c:80", "d:80"},
+		},
+		{
+			name:  "limit",
+			query: map[string][]string{"limit": {"2"}},
+			want:  []string{"a:80", "b:80"},
+		},
+		{
+			name:  "offset",
+			query: map[string][]string{"offset": {"2"}},
+			want:  []string{"c:80", "d:80"},
+		},
+		{
+			name:  "offset and limit",
+			query: map[string][]string{"offset": {"1"}, "limit": {"2"}},
+			want:  []string{"b:80", "c:80"},
+		},
+		{
+			name:  "offset past end",
+			query: map[string][]string{"offset": {"100"}},
+			want:  []string{},
+		},
+		{
+			name:      "negative offset",
+			query:     map[string][]string{"offset": {"-1"}},
+			wantError: true,
+		},
+		{
+			name:      "invalid limit",
+			query:     map[string][]string{"limit": {"nope"}},
+			wantError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := paginateUpstreamStatuses(all, tc.query)
+			if tc.wantError {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %+v", tc.want, got)
+			}
+			for i, addr := range tc.want {
+				if got[i].Address != addr {
+					t.Errorf("expected %v, got %+v", tc.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestHandleUpstreamByAddressMethodNotAllowed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/reverse_proxy/upstreams/a:80", nil)
+	rr := httptest.NewRecorder()
+
+	err := adminUpstreams{}.handleUpstreamByAddress(rr, req)
+
+	var apiErr caddy.APIError
+	if !asAPIError(t, err, &apiErr) {
+		return
+	}
+	if apiErr.HTTPStatus != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", apiErr.HTTPStatus)
+	}
+}
+
+func TestHandleUpstreamByAddressNoAddress(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/reverse_proxy/upstreams/", nil)
+	rr := httptest.NewRecorder()
+
+	err := adminUpstreams{}.handleUpstreamByAddress(rr, req)
+
+	var apiErr caddy.APIError
+	if !asAPIError(t, err, &apiErr) {
+		return
+	}
+	if apiErr.HTTPStatus != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", apiErr.HTTPStatus)
+	}
+}
+
+func TestHandleUpstreamByAddressUnknownAddress(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/reverse_proxy/upstreams/nonexistent:80", nil)
+	rr := httptest.NewRecorder()
+
+	err := adminUpstreams{}.handleUpstreamByAddress(rr, req)
+
+	var apiErr caddy.APIError
+	if !asAPIError(t, err, &apiErr) {
+		return
+	}
+	if apiErr.HTTPStatus != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", apiErr.HTTPStatus)
+	}
+}
+
+// asAPIError fails the test and returns false if err isn't a
+// caddy.APIError, otherwise it populates target and returns true.
+func asAPIError(t *testing.T, err error, target *caddy.APIError) bool {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected an error, got none")
+		return false
+	}
+	apiErr, ok := err.(caddy.APIError)
+	if !ok {
+		t.Fatalf("expected a caddy.APIError, got %T: %v", err, err)
+		return false
+	}
+	*target = apiErr
+	return true
+}